@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==== пакетная классификация ====
+
+// batchResult — результат классификации одного URL внутри батча.
+type batchResult struct {
+	URL              string   `json:"url"`
+	Summary          string   `json:"summary,omitempty"`
+	Lang             string   `json:"lang,omitempty"`
+	Source           string   `json:"source,omitempty"`
+	Keywords         []string `json:"keywords,omitempty"`
+	NegativeKeywords []string `json:"negative_keywords,omitempty"`
+	DurationMs       int64    `json:"duration_ms"`
+	Error            string   `json:"error,omitempty"`
+}
+
+const defaultBatchWorkers = 8
+
+func batchWorkerCount() int {
+	if v := strings.TrimSpace(os.Getenv("BATCH_WORKERS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultBatchWorkers
+}
+
+func batchDeadline() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("BATCH_TIMEOUT_SEC")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 60 * time.Second
+}
+
+// batchHandler принимает список URL (JSON-массив строк или text/plain,
+// по одному URL в строке — совместимо с файлами вида Alexa-500) и
+// прогоняет его через classifyOne на пуле воркеров.
+//
+// Ответ отдаётся буферизованным JSON-массивом, либо, если клиент прислал
+// Accept: application/x-ndjson, построчным NDJSON-потоком — по одной
+// строке на завершённый URL, без ожидания остальных.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 5<<20)) // 5 MiB лимит на список
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	urls, err := parseBatchInput(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(urls) == 0 {
+		http.Error(w, "no urls provided", http.StatusBadRequest)
+		return
+	}
+
+	// общий дедлайн на весь батч — при истечении отдаём то, что успели собрать
+	ctx, cancel := context.WithTimeout(r.Context(), batchDeadline())
+	defer cancel()
+
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		runBatchStreaming(ctx, w, urls)
+		return
+	}
+	runBatchBuffered(ctx, w, urls)
+}
+
+// runBatchBuffered собирает все результаты и отдаёт их одним JSON-массивом,
+// сохраняя порядок входного списка.
+func runBatchBuffered(ctx context.Context, w http.ResponseWriter, urls []string) {
+	results := make([]batchResult, len(urls))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchWorkerCount())
+	for i, u := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, u string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = classifyBatchItem(ctx, u)
+		}(i, u)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+// runBatchStreaming отдаёт по одной JSON-строке на каждый завершённый URL,
+// не дожидаясь остальных (NDJSON), и флашит соединение после каждой строки.
+func runBatchStreaming(ctx context.Context, w http.ResponseWriter, urls []string) {
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	sem := make(chan struct{}, batchWorkerCount())
+
+	for _, u := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(u string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res := classifyBatchItem(ctx, u)
+
+			mu.Lock()
+			_ = enc.Encode(res)
+			if flusher != nil {
+				flusher.Flush()
+			}
+			mu.Unlock()
+		}(u)
+	}
+	wg.Wait()
+}
+
+func classifyBatchItem(ctx context.Context, rawURL string) batchResult {
+	start := time.Now()
+	resp, _, err := classifyOne(ctx, rawURL, renderAuto)
+	res := batchResult{
+		URL:        rawURL,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Summary = resp.Summary
+	res.Lang = resp.Lang
+	res.Source = resp.Source
+	res.Keywords = resp.Keywords
+	res.NegativeKeywords = resp.NegativeKeywords
+	return res
+}
+
+// parseBatchInput разбирает тело запроса в список «сырых» URL в зависимости
+// от Content-Type: JSON-массив строк, либо text/plain со списком URL по
+// одному в строке (формат Alexa-500: "ранг,домен" тоже поддерживается).
+func parseBatchInput(contentType string, body []byte) ([]string, error) {
+	if strings.Contains(strings.ToLower(contentType), "application/json") {
+		var raw []string
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, errors.New("bad JSON: expected an array of URLs")
+		}
+		return normalizeBatchURLs(raw), nil
+	}
+	return normalizeBatchURLs(splitTextList(string(body))), nil
+}
+
+func splitTextList(s string) []string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// normalizeBatchURLs приводит «сырые» строки списка к абсолютным URL:
+// отбрасывает префикс ранга в духе "1,google.com" и достраивает схему
+// https://, если её нет.
+func normalizeBatchURLs(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, raw := range in {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if idx := strings.LastIndex(raw, ","); idx != -1 {
+			raw = strings.TrimSpace(raw[idx+1:])
+		}
+		if raw == "" {
+			continue
+		}
+		if !strings.Contains(raw, "://") {
+			raw = "https://" + raw
+		}
+		out = append(out, raw)
+	}
+	return out
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ==== кэш результатов классификации ====
+
+// cacheEntry — то, что лежит в сторе по канонизированному URL: готовый
+// ответ плюс заголовки для условного GET при ревалидации.
+type cacheEntry struct {
+	Response     classifyResponse `json:"response"`
+	ETag         string           `json:"etag,omitempty"`
+	LastModified string           `json:"last_modified,omitempty"`
+	CachedAt     time.Time        `json:"cached_at"`
+}
+
+// cacheStore — абстракция над хранилищем, чтобы /classify мог работать
+// как с постоянным BoltDB, так и с in-memory фолбэком в тестах.
+type cacheStore interface {
+	Get(key string) (cacheEntry, bool, error)
+	Set(key string, entry cacheEntry) error
+	Delete(key string) error
+	Purge() error
+}
+
+var cacheBucketName = []byte("classify")
+
+// boltCacheStore — постоянное хранилище на BoltDB (один файл, без внешних
+// зависимостей вроде Redis).
+type boltCacheStore struct {
+	db *bbolt.DB
+}
+
+func newBoltCacheStore(path string) (*boltCacheStore, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(cacheBucketName)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltCacheStore{db: db}, nil
+}
+
+func (s *boltCacheStore) Get(key string) (cacheEntry, bool, error) {
+	var entry cacheEntry
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(cacheBucketName).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &entry)
+	})
+	if err != nil {
+		return cacheEntry{}, false, err
+	}
+	return entry, found, nil
+}
+
+func (s *boltCacheStore) Set(key string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(cacheBucketName).Put([]byte(key), data)
+	})
+}
+
+func (s *boltCacheStore) Delete(key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(cacheBucketName).Delete([]byte(key))
+	})
+}
+
+func (s *boltCacheStore) Purge() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(cacheBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(cacheBucketName)
+		return err
+	})
+}
+
+// memCacheStore — in-memory фолбэк: используется в тестах и когда
+// CACHE_PATH не задан.
+type memCacheStore struct {
+	mu   sync.RWMutex
+	data map[string]cacheEntry
+}
+
+func newMemCacheStore() *memCacheStore {
+	return &memCacheStore{data: make(map[string]cacheEntry)}
+}
+
+func (s *memCacheStore) Get(key string) (cacheEntry, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.data[key]
+	return entry, ok, nil
+}
+
+func (s *memCacheStore) Set(key string, entry cacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = entry
+	return nil
+}
+
+func (s *memCacheStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memCacheStore) Purge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = make(map[string]cacheEntry)
+	return nil
+}
+
+var resultCache = newResultCache()
+
+func newResultCache() cacheStore {
+	path := strings.TrimSpace(os.Getenv("CACHE_PATH"))
+	if path == "" {
+		log.Println("CACHE_PATH not set — using in-memory cache store")
+		return newMemCacheStore()
+	}
+	store, err := newBoltCacheStore(path)
+	if err != nil {
+		log.Printf("WARN: failed to open bolt cache at %s: %v — falling back to in-memory", path, err)
+		return newMemCacheStore()
+	}
+	log.Printf("INFO: persistent cache store opened at %s", path)
+	return store
+}
+
+func cacheTTL() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("CACHE_TTL_HOURS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Hour
+		}
+	}
+	return 24 * time.Hour
+}
+
+func urlHash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalCacheKey канонизирует URL перед хэшированием: нижний регистр
+// схемы и хоста, без фрагмента — чтобы "#section" не плодил новые записи.
+func canonicalCacheKey(u *url.URL) string {
+	c := *u
+	c.Fragment = ""
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.Host = strings.ToLower(c.Host)
+	return urlHash(c.String())
+}
+
+// ==== HTTP-хэндлеры управления кэшем ====
+
+func cacheGetHandler(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	entry, ok, err := resultCache.Get(hash)
+	if err != nil {
+		http.Error(w, "cache error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(entry.Response)
+}
+
+func cacheDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	if err := resultCache.Delete(hash); err != nil {
+		http.Error(w, "cache error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func cachePurgeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := resultCache.Purge(); err != nil {
+		http.Error(w, "cache error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	htmlnode "golang.org/x/net/html"
+)
+
+// ==== извлечение видимого текста ====
+
+// extractVisibleText выбирает движок извлечения контента: по умолчанию —
+// скоринговый Readability-style экстрактор, либо старый селекторный список,
+// если задано EXTRACTOR=legacy (для A/B сравнения). Перед основным текстом
+// добавляется высокосигнальный префикс из structured data (og/twitter/JSON-LD,
+// см. extractStructuredDataPrefix) — он обычно даёт summarizer'у лучшие
+// ключевые слова для e-commerce, чем один только h1/h2/h3/p/li.
+func extractVisibleText(html string) string {
+	var body string
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("EXTRACTOR")), "legacy") {
+		body = legacyExtractVisibleText(html)
+	} else {
+		body = readabilityExtractVisibleText(html)
+	}
+
+	prefix := extractStructuredDataPrefix(html)
+	if prefix == "" {
+		return body
+	}
+	if body == "" {
+		return prefix
+	}
+	return prefix + " " + body
+}
+
+// ==== structured data: og/twitter meta + JSON-LD ====
+
+var structuredDataTypes = map[string]bool{
+	"organization":  true,
+	"product":       true,
+	"store":         true,
+	"localbusiness": true,
+	"website":       true,
+}
+
+// extractStructuredDataPrefix собирает og:*/twitter:* мета-теги и JSON-LD
+// блоки интересующих нас типов (Organization/Product/Store/LocalBusiness/
+// WebSite), вытаскивая name/description/category/areaServed и т.п. Страницы
+// часто кладут туда более чистое описание тематики, чем видно в теле.
+func extractStructuredDataPrefix(html string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return ""
+	}
+
+	var parts []string
+	seen := make(map[string]bool)
+	add := func(label, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+		key := label + ":" + value
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		parts = append(parts, label+": "+value)
+	}
+
+	doc.Find(`meta[property^="og:"]`).Each(func(_ int, s *goquery.Selection) {
+		prop, _ := s.Attr("property")
+		content, _ := s.Attr("content")
+		add(prop, content)
+	})
+	doc.Find(`meta[name^="twitter:"]`).Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		content, _ := s.Attr("content")
+		add(name, content)
+	})
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		for _, entry := range parseJSONLD(s.Text()) {
+			addJSONLDEntry(entry, add)
+		}
+	})
+
+	text := strings.Join(parts, "; ")
+	if len(text) > 2000 {
+		text = text[:2000]
+	}
+	return text
+}
+
+// parseJSONLD разбирает содержимое одного <script type="application/ld+json">:
+// это может быть один объект, массив объектов, либо обёртка "@graph".
+func parseJSONLD(raw string) []map[string]any {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+
+	var single map[string]any
+	if err := json.Unmarshal([]byte(raw), &single); err == nil {
+		if graph, ok := single["@graph"].([]any); ok {
+			out := make([]map[string]any, 0, len(graph))
+			for _, g := range graph {
+				if m, ok := g.(map[string]any); ok {
+					out = append(out, m)
+				}
+			}
+			return out
+		}
+		return []map[string]any{single}
+	}
+
+	var list []map[string]any
+	if err := json.Unmarshal([]byte(raw), &list); err == nil {
+		return list
+	}
+	return nil
+}
+
+// addJSONLDEntry добавляет поля интересующих нас типов через переданный
+// add(label, value); прочие @type (BreadcrumbList, FAQPage и т.п.) игнорируются.
+func addJSONLDEntry(entry map[string]any, add func(label, value string)) {
+	t, _ := entry["@type"].(string)
+	if !structuredDataTypes[strings.ToLower(t)] {
+		return
+	}
+
+	if name, ok := entry["name"].(string); ok {
+		add("name", name)
+	}
+	if desc, ok := entry["description"].(string); ok {
+		add("description", desc)
+	}
+	if category, ok := entry["category"].(string); ok {
+		add("category", category)
+	}
+	switch area := entry["areaServed"].(type) {
+	case string:
+		add("areaServed", area)
+	case map[string]any:
+		if name, ok := area["name"].(string); ok {
+			add("areaServed", name)
+		}
+	}
+}
+
+// legacyExtractVisibleText — прежний подход: вырезать явно шумные теги и
+// собрать текст из h1/h2/h3/p/li. Хорошо работает на простых страницах, но
+// легко ломается на SPA-обёртках и насыщенных сайдбарами лендингах.
+func legacyExtractVisibleText(html string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return ""
+	}
+
+	doc.Find("script, style, noscript, nav, header, footer, template, svg, iframe, aside").Remove()
+
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+	metaDesc := ""
+	doc.Find(`meta[name="description"]`).Each(func(_ int, s *goquery.Selection) {
+		if v, ok := s.Attr("content"); ok {
+			metaDesc = strings.TrimSpace(v)
+		}
+	})
+
+	var parts []string
+	if title != "" && !legacyIsNoisy(title) {
+		parts = append(parts, legacyClean(title))
+	}
+	if metaDesc != "" && !legacyIsNoisy(metaDesc) {
+		parts = append(parts, legacyClean(metaDesc))
+	}
+
+	doc.Find("h1, h2, h3, p, li").Each(func(_ int, s *goquery.Selection) {
+		t := legacyClean(s.Text())
+		if t != "" && !legacyIsNoisy(t) && len(t) >= 10 {
+			parts = append(parts, t)
+		}
+	})
+
+	text := strings.Join(parts, " ")
+	if len(text) > 20000 {
+		text = text[:20000]
+	}
+	return text
+}
+
+func legacyClean(s string) string {
+	return strings.Join(strings.Fields(strings.TrimSpace(s)), " ")
+}
+
+func legacyIsNoisy(s string) bool {
+	ls := strings.ToLower(s)
+	if strings.Contains(ls, "{") && strings.Contains(ls, "}") {
+		return true
+	}
+	if strings.Contains(ls, "[") && strings.Contains(ls, "]") {
+		return true
+	}
+	if strings.Contains(ls, "widgets") || strings.Contains(ls, "cookie") || strings.Contains(ls, "tracking") {
+		return true
+	}
+	var non, letters int
+	for _, r := range ls {
+		if (r >= 'a' && r <= 'z') || (r >= 'а' && r <= 'я') || r == 'ё' {
+			letters++
+		} else if r != ' ' {
+			non++
+		}
+	}
+	return letters > 0 && float64(non)/float64(letters+1) > 0.7
+}
+
+// ==== readability-style экстрактор ====
+
+const readabilityMinTextLen = 25
+
+var (
+	readabilityPositiveClassRe = regexp.MustCompile(`(?i)article|main|content|story|body|post`)
+	readabilityNegativeClassRe = regexp.MustCompile(`(?i)comment|share|sidebar|footer|promo`)
+)
+
+// readabilityExtractVisibleText скорит блочные элементы (p/article/section/div)
+// по длине текста, числу запятых, плотности ссылок и весу тега/класса,
+// частично пробрасывает счёт родителю и деду, и выбирает лучшего предка как
+// корень основного контента — подход, близкий к Mozilla Readability и
+// используемый в ридерах вроде Miniflux.
+func readabilityExtractVisibleText(html string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return ""
+	}
+
+	// технический мусор вырезаем сразу — он никогда не кандидат в контент
+	doc.Find("script, style, noscript, template, svg, iframe").Remove()
+
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+	metaDesc := ""
+	doc.Find(`meta[name="description"]`).Each(func(_ int, s *goquery.Selection) {
+		if v, ok := s.Attr("content"); ok {
+			metaDesc = strings.TrimSpace(v)
+		}
+	})
+
+	scores := make(map[*htmlnode.Node]float64)
+	doc.Find("p, article, section, div").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if len(text) < readabilityMinTextLen {
+			return
+		}
+
+		score := readabilityTagWeight(s)
+		score += float64(len(text)) / 100.0
+		score += float64(strings.Count(text, ","))
+
+		linkLen := 0
+		s.Find("a").Each(func(_ int, a *goquery.Selection) {
+			linkLen += len(strings.TrimSpace(a.Text()))
+		})
+		if density := float64(linkLen) / float64(len(text)); density > 0 {
+			score -= score * density
+		}
+
+		node := s.Get(0)
+		scores[node] += score
+
+		if parent := s.Parent(); parent.Length() > 0 {
+			pNode := parent.Get(0)
+			scores[pNode] += score * 0.5
+			if grandparent := parent.Parent(); grandparent.Length() > 0 {
+				scores[grandparent.Get(0)] += score * 0.25
+			}
+		}
+	})
+
+	var best *htmlnode.Node
+	bestScore := 0.0
+	for node, score := range scores {
+		if score > bestScore {
+			bestScore = score
+			best = node
+		}
+	}
+
+	var bodyText string
+	if best != nil {
+		root := goquery.NewDocumentFromNode(best).Selection
+		root.Find("nav, header, footer, aside, form").Remove()
+		root.Find("*").Each(func(_ int, s *goquery.Selection) {
+			classID := strings.ToLower(s.AttrOr("class", "") + " " + s.AttrOr("id", ""))
+			if readabilityNegativeClassRe.MatchString(classID) {
+				s.Remove()
+			}
+		})
+		bodyText = legacyClean(root.Text())
+	}
+
+	var parts []string
+	if title != "" && !legacyIsNoisy(title) {
+		parts = append(parts, legacyClean(title))
+	}
+	if metaDesc != "" && !legacyIsNoisy(metaDesc) {
+		parts = append(parts, legacyClean(metaDesc))
+	}
+	if bodyText != "" {
+		parts = append(parts, bodyText)
+	}
+
+	text := strings.Join(parts, " ")
+	if len(text) > 20000 {
+		text = text[:20000]
+	}
+	return text
+}
+
+// readabilityTagWeight — вклад тега и его class/id в базовый счёт блока.
+func readabilityTagWeight(s *goquery.Selection) float64 {
+	var w float64
+	switch strings.ToLower(goquery.NodeName(s)) {
+	case "article", "main", "section":
+		w += 25
+	case "form", "aside", "nav":
+		w -= 25
+	}
+
+	classID := strings.ToLower(s.AttrOr("class", "") + " " + s.AttrOr("id", ""))
+	if readabilityPositiveClassRe.MatchString(classID) {
+		w += 25
+	}
+	if readabilityNegativeClassRe.MatchString(classID) {
+		w -= 25
+	}
+	return w
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadabilityExtractVisibleText(t *testing.T) {
+	cases := []struct {
+		name        string
+		fixture     string
+		wantContain []string
+		wantAbsent  []string
+	}{
+		{
+			name:        "news article",
+			fixture:     "news_article.html",
+			wantContain: []string{"конференция", "экспертов"},
+			wantAbsent:  []string{"Подпишитесь на рассылку", "используем cookies"},
+		},
+		{
+			name:        "e-commerce category",
+			fixture:     "ecommerce_category.html",
+			wantContain: []string{"куртка", "мембраной"},
+			wantAbsent:  []string{"Фильтры", "Служба поддержки"},
+		},
+		{
+			name:        "SPA landing page",
+			fixture:     "spa_landing.html",
+			wantContain: []string{"документов", "учётные системы"},
+			wantAbsent:  []string{"конфиденциальности", "Тарифы"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("testdata", tc.fixture))
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			got := readabilityExtractVisibleText(string(raw))
+			for _, want := range tc.wantContain {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected extracted text to contain %q, got: %s", want, got)
+				}
+			}
+			for _, unwanted := range tc.wantAbsent {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("expected extracted text NOT to contain %q, got: %s", unwanted, got)
+				}
+			}
+		})
+	}
+}
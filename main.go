@@ -13,7 +13,6 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/openai/openai-go/v2"
 )
 
 // ==== структуры для входа/выхода ====
@@ -25,13 +24,18 @@ type classifyRequest struct {
 type classifyResponse struct {
 	Summary          string   `json:"summary"`
 	Lang             string   `json:"lang"`
-	Source           string   `json:"source"` // "ai" / "heuristic" / "ai_quota" / "ai_error"
+	Source           string   `json:"source"` // "ai:openai" / "ai:anthropic" / "ai:local" / "heuristic" / "ai_quota"
 	Keywords         []string `json:"keywords,omitempty"`
 	NegativeKeywords []string `json:"negative_keywords,omitempty"`
 }
 
 // ==== HTTP-обработчик ====
 
+var (
+	errURLRequired = errors.New("url is required")
+	errURLInvalid  = errors.New("invalid url")
+)
+
 func classifyHandler(w http.ResponseWriter, r *http.Request) {
 	// 1) принимаем только POST
 	if r.Method != http.MethodPost {
@@ -46,60 +50,123 @@ func classifyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3) валидируем URL
-	raw := strings.TrimSpace(req.URL)
-	if raw == "" {
-		http.Error(w, "url is required", http.StatusBadRequest)
+	// 3) общий таймаут на работу хэндлера
+	ctx, cancel := context.WithTimeout(r.Context(), 12*time.Second)
+	defer cancel()
+
+	// 4) прогоняем весь пайплайн через общую функцию
+	mode := parseRenderMode(r.URL.Query().Get("render"))
+	resp, cacheStatus, err := classifyOne(ctx, req.URL, mode)
+	if err != nil {
+		switch {
+		case errors.Is(err, errURLRequired), errors.Is(err, errURLInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, errRobotsDisallowed):
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "robots_disallowed"})
+		default:
+			http.Error(w, "fetch failed: "+err.Error(), http.StatusBadGateway)
+		}
 		return
 	}
+
+	w.Header().Set("X-Cache", cacheStatus)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// classifyOne прогоняет один URL через весь пайплайн
+// (fetchHTML → extractVisibleText → summarizeViaChain/heuristicSummarize → fallbackSummary),
+// мемоизируя результат в resultCache по канонизированному URL. Отдаёт
+// готовый classifyResponse и статус кэша ("hit"/"miss"/"revalidated").
+// Используется как одиночным хэндлером, так и воркерами пакетного
+// /classify/batch. mode управляет headless-рендерингом JS (см. render.go):
+// "auto" решает по объёму извлечённого текста, "js" форсирует рендер (и
+// всегда обходит кэш), "never" рендер полностью отключает.
+func classifyOne(ctx context.Context, rawURL string, mode renderMode) (classifyResponse, string, error) {
+	raw := strings.TrimSpace(rawURL)
+	if raw == "" {
+		return classifyResponse{}, "", errURLRequired
+	}
 	u, err := url.ParseRequestURI(raw)
 	if err != nil || u.Scheme == "" || u.Host == "" {
-		http.Error(w, "invalid url", http.StatusBadRequest)
-		return
+		return classifyResponse{}, "", errURLInvalid
 	}
 
-	log.Printf("useAI=%v url=%s", useAI, u.String())
+	log.Printf("aiEnabled=%v url=%s render=%s", aiEnabled(), u.String(), mode)
 
-	// 4) общий таймаут на работу хэндлера
-	ctx, cancel := context.WithTimeout(r.Context(), 12*time.Second)
-	defer cancel()
+	key := canonicalCacheKey(u)
+	if mode != renderJS {
+		if entry, ok, cerr := resultCache.Get(key); cerr == nil && ok {
+			if time.Since(entry.CachedAt) < cacheTTL() {
+				return entry.Response, "hit", nil
+			}
+
+			// запись устарела — пробуем условный GET по ETag/Last-Modified
+			fr, notModified, ferr := fetchHTMLConditional(ctx, u.String(), entry.ETag, entry.LastModified)
+			if ferr != nil {
+				return classifyResponse{}, "", ferr
+			}
+			if notModified {
+				entry.CachedAt = time.Now()
+				_ = resultCache.Set(key, entry)
+				return entry.Response, "revalidated", nil
+			}
+
+			resp, cerr2 := classifyFromHTML(ctx, u, maybeRenderJS(ctx, u, fr.HTML, mode))
+			if cerr2 != nil {
+				return classifyResponse{}, "", cerr2
+			}
+			_ = resultCache.Set(key, cacheEntry{Response: resp, ETag: fr.ETag, LastModified: fr.LastModified, CachedAt: time.Now()})
+			return resp, "miss", nil
+		}
+	}
 
-	// 5) скачиваем HTML
-	html, err := fetchHTML(ctx, u.String())
+	fr, _, err := fetchHTMLConditional(ctx, u.String(), "", "")
 	if err != nil {
-		http.Error(w, "fetch failed: "+err.Error(), http.StatusBadGateway)
-		return
+		return classifyResponse{}, "", err
+	}
+	resp, err := classifyFromHTML(ctx, u, maybeRenderJS(ctx, u, fr.HTML, mode))
+	if err != nil {
+		return classifyResponse{}, "", err
 	}
+	_ = resultCache.Set(key, cacheEntry{Response: resp, ETag: fr.ETag, LastModified: fr.LastModified, CachedAt: time.Now()})
+	return resp, "miss", nil
+}
 
-	// 6) извлекаем видимый текст
+// classifyFromHTML — собственно пайплайн классификации по уже скачанному
+// HTML (извлечение текста → AI/эвристика → фолбэк).
+func classifyFromHTML(ctx context.Context, u *url.URL, html string) (classifyResponse, error) {
 	text := extractVisibleText(html)
 	log.Printf("extracted text length: %d", len(text))
 
-	// === НОВОЕ: если текста мало — пробуем ИИ по домену (и title/meta), иначе фолбэк ===
+	// === если текста мало — пробуем ИИ по домену (и title/meta), иначе фолбэк ===
 	if len(strings.TrimSpace(text)) < 40 {
 		brief := fallbackSummary(u, html) // title/meta/host
-		if useAI {
+		shortSource := "heuristic"
+		if aiEnabled() {
 			// соберём небольшой вход для модели
 			shortInput := "Домен: " + u.Hostname()
 			if b := strings.TrimSpace(brief); b != "" {
 				shortInput += "\nTitle/Meta: " + b
 			}
 
-			sum, kws, negs, aiErr := summarizeWithAI(ctx, shortInput)
-			log.Printf("AI (short-text) finished, err=%v", aiErr)
-			if aiErr == nil && strings.TrimSpace(sum) != "" {
-				resp := classifyResponse{
-					Summary:          sum,
+			sum, src, aiErr := summarizeViaChain(ctx, shortInput)
+			log.Printf("AI (short-text) finished, source=%s err=%v", src, aiErr)
+			if aiErr == nil && strings.TrimSpace(sum.Text) != "" {
+				return classifyResponse{
+					Summary:          sum.Text,
 					Lang:             "ru",
-					Source:           "ai",
-					Keywords:         kws,
-					NegativeKeywords: negs,
-				}
-				w.Header().Set("Content-Type", "application/json; charset=utf-8")
-				_ = json.NewEncoder(w).Encode(resp)
-				return
+					Source:           src,
+					Keywords:         sum.Keywords,
+					NegativeKeywords: sum.NegativeKeywords,
+				}, nil
 			}
 			log.Println("AI short-text failed → fallback to heuristic")
+			if src == "ai_quota" {
+				shortSource = src
+			}
 		}
 
 		// эвристический фолбэк
@@ -107,14 +174,11 @@ func classifyHandler(w http.ResponseWriter, r *http.Request) {
 		if strings.TrimSpace(summary) == "" {
 			summary = "Веб-сайт компании/сервиса " + u.Hostname()
 		}
-		resp := classifyResponse{
+		return classifyResponse{
 			Summary: summary,
 			Lang:    "ru",
-			Source:  "heuristic",
-		}
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		_ = json.NewEncoder(w).Encode(resp)
-		return
+			Source:  shortSource,
+		}, nil
 	}
 
 	// === Текста достаточно: обычная логика ===
@@ -125,16 +189,18 @@ func classifyHandler(w http.ResponseWriter, r *http.Request) {
 		negs    []string
 	)
 
-	if useAI {
-		source = "ai"
-		sum, kk, nn, aiErr := summarizeWithAI(ctx, text)
-		log.Printf("AI call finished, err=%v", aiErr)
-		if aiErr != nil || strings.TrimSpace(sum) == "" {
+	if aiEnabled() {
+		sum, src, aiErr := summarizeViaChain(ctx, text)
+		log.Printf("AI call finished, source=%s err=%v", src, aiErr)
+		if aiErr != nil || strings.TrimSpace(sum.Text) == "" {
 			log.Println("AI failed or empty → fallback to heuristic")
 			summary = heuristicSummarize(text)
 			source = "heuristic"
+			if src == "ai_quota" {
+				source = src
+			}
 		} else {
-			summary, kws, negs = sum, kk, nn
+			summary, kws, negs, source = sum.Text, sum.Keywords, sum.NegativeKeywords, src
 		}
 	} else {
 		summary = heuristicSummarize(text)
@@ -150,16 +216,13 @@ func classifyHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 8) отвечаем JSON
-	resp := classifyResponse{
+	return classifyResponse{
 		Summary:          summary,
 		Lang:             "ru",
 		Source:           source,
 		Keywords:         kws,
 		NegativeKeywords: negs,
-	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_ = json.NewEncoder(w).Encode(resp)
+	}, nil
 }
 
 // ==== HTTP-клиент ====
@@ -168,12 +231,6 @@ var httpClient = &http.Client{
 	Timeout: 10 * time.Second,
 }
 
-var aiClient = openai.NewClient()
-
-var useAI = strings.ToLower(os.Getenv("USE_AI")) == "true"
-
-var modelName = "gpt-3.5-turbo" // как и было
-
 func maskKey(s string) string {
 	if len(s) <= 8 {
 		return s
@@ -183,101 +240,71 @@ func maskKey(s string) string {
 
 // ==== загрузка HTML ====
 
+// fetchResult — HTML-страница вместе с заголовками валидации кэша.
+type fetchResult struct {
+	HTML         string
+	ETag         string
+	LastModified string
+}
+
 func fetchHTML(ctx context.Context, target string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	fr, _, err := fetchHTMLConditional(ctx, target, "", "")
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("User-Agent", "site-check/1.0 (+learning-go)")
+	return fr.HTML, nil
+}
 
-	res, err := httpClient.Do(req)
+// fetchHTMLConditional скачивает страницу, при наличии prevETag/prevLastModified
+// выполняет условный GET (If-None-Match/If-Modified-Since). Второе
+// возвращаемое значение — true, если сервер ответил 304 Not Modified
+// (в этом случае fetchResult пуст, нужно использовать закэшированный).
+func fetchHTMLConditional(ctx context.Context, target, prevETag, prevLastModified string) (fetchResult, bool, error) {
+	tu, err := url.Parse(target)
 	if err != nil {
-		return "", err
+		return fetchResult{}, false, err
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return "", errors.New("non-2xx status: " + res.Status)
+	if !isAllowedByRobots(ctx, tu) {
+		return fetchResult{}, false, errRobotsDisallowed
 	}
-
-	b, err := io.ReadAll(io.LimitReader(res.Body, 2<<20)) // 2 MiB лимит
-	if err != nil {
-		return "", err
+	if err := waitRateLimit(ctx, tu.Host); err != nil {
+		return fetchResult{}, false, err
 	}
-	return string(b), nil
-}
-
-// ==== извлечение видимого текста ====
 
-func extractVisibleText(html string) string {
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 	if err != nil {
-		return ""
+		return fetchResult{}, false, err
 	}
-
-	// убрать шумные блоки
-	doc.Find("script, style, noscript, nav, header, footer, template, svg, iframe, aside").Remove()
-
-	// берём title и meta description в приоритет
-	title := strings.TrimSpace(doc.Find("title").First().Text())
-	metaDesc := ""
-	doc.Find(`meta[name="description"]`).Each(func(_ int, s *goquery.Selection) {
-		if v, ok := s.Attr("content"); ok {
-			metaDesc = strings.TrimSpace(v)
-		}
-	})
-
-	clean := func(s string) string {
-		// нормализуем пробелы
-		s = strings.Join(strings.Fields(strings.TrimSpace(s)), " ")
-		return s
+	req.Header.Set("User-Agent", "site-check/1.0 (+learning-go)")
+	if prevETag != "" {
+		req.Header.Set("If-None-Match", prevETag)
+	}
+	if prevLastModified != "" {
+		req.Header.Set("If-Modified-Since", prevLastModified)
 	}
 
-	isNoisy := func(s string) bool {
-		ls := strings.ToLower(s)
-		// явные признаки JSON/шаблонов/тех. мусора
-		if strings.Contains(ls, "{") && strings.Contains(ls, "}") {
-			return true
-		}
-		if strings.Contains(ls, "[") && strings.Contains(ls, "]") {
-			return true
-		}
-		if strings.Contains(ls, "widgets") || strings.Contains(ls, "cookie") || strings.Contains(ls, "tracking") {
-			return true
-		}
-		// слишком много «небуквенных» символов → похоже на код
-		var non, letters int
-		for _, r := range ls {
-			if (r >= 'a' && r <= 'z') || (r >= 'а' && r <= 'я') || r == 'ё' {
-				letters++
-			} else if r != ' ' {
-				non++
-			}
-		}
-		return letters > 0 && float64(non)/float64(letters+1) > 0.7
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fetchResult{}, false, err
 	}
+	defer res.Body.Close()
 
-	var parts []string
-	if title != "" && !isNoisy(title) {
-		parts = append(parts, clean(title))
+	if res.StatusCode == http.StatusNotModified {
+		return fetchResult{}, true, nil
 	}
-	if metaDesc != "" && !isNoisy(metaDesc) {
-		parts = append(parts, clean(metaDesc))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fetchResult{}, false, errors.New("non-2xx status: " + res.Status)
 	}
 
-	// собираем важный текст страницы
-	doc.Find("h1, h2, h3, p, li").Each(func(_ int, s *goquery.Selection) {
-		t := clean(s.Text())
-		if t != "" && !isNoisy(t) && len(t) >= 10 {
-			parts = append(parts, t)
-		}
-	})
-
-	text := strings.Join(parts, " ")
-	if len(text) > 20000 {
-		text = text[:20000]
+	b, err := io.ReadAll(io.LimitReader(res.Body, 2<<20)) // 2 MiB лимит
+	if err != nil {
+		return fetchResult{}, false, err
 	}
-	return text
+	return fetchResult{
+		HTML:         string(b),
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}, false, nil
 }
 
 // ==== простая эвристика ====
@@ -376,74 +403,6 @@ func splitSentences(s string) []string {
 	return out
 }
 
-func summarizeWithAI(ctx context.Context, text string) (string, []string, []string, error) {
-	// поджимаем вход: модели не нужен весь роман
-	if len(text) > 4000 {
-		text = text[:4000]
-	}
-
-	// создаём «дочерний» контекст с небольшим таймаутом,
-	// чтобы ИИ не подвесил наш хэндлер
-	cctx, cancel := context.WithTimeout(ctx, 15*time.Second)
-	defer cancel()
-
-	// Просим СТРОГО JSON (чтобы удобно парсить в поля ответа)
-	prompt := `Ты — сервис классификации сайтов.
-
-1) Кратко, одной деловой фразой по-русски опиши тематику сайта (сфера/услуга/товар и, если явно есть, город/бренд).
-   Не добавляй лишних слов, без пояснений, без ссылок.
-
-2) Сгенерируй список ключевых слов и фраз для запуска рекламы в Яндекс.Директ (30–40 штук, только по этому контенту).
-
-3) Сформируй список минус-слов (30–50), чтобы отсеять нерелевантные запросы.
-
-Верни СТРОГО валидный JSON ровно такой структуры (без пояснений снаружи):
-{
-  "summary": "краткое описание одной фразой",
-  "keywords": ["...", "..."],
-  "negative_keywords": ["...", "..."]
-}
-
-Контент сайта:
-` + text
-
-	resp, err := aiClient.Chat.Completions.New(cctx, openai.ChatCompletionNewParams{
-		Model: "gpt-3.5-turbo", // как было раньше
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(prompt),
-		},
-		// ответ длиннее — увеличим лимит
-		MaxTokens:   openai.Int(800),
-		Temperature: openai.Float(0.2),
-		Seed:        openai.Int(42),
-	})
-	if err != nil {
-		return "", nil, nil, err
-	}
-	if len(resp.Choices) == 0 {
-		return "", nil, nil, errors.New("no choices from AI")
-	}
-
-	raw := strings.TrimSpace(resp.Choices[0].Message.Content)
-	if raw == "" {
-		return "", nil, nil, errors.New("empty AI response")
-	}
-
-	// временная структура для парсинга JSON
-	var tmp struct {
-		Summary          string   `json:"summary"`
-		Keywords         []string `json:"keywords"`
-		NegativeKeywords []string `json:"negative_keywords"`
-	}
-	if jerr := json.Unmarshal([]byte(raw), &tmp); jerr != nil {
-		// если пришёл невалидный JSON — вернём хотя бы summary как текст,
-		// списки оставим пустыми (эвристика всё равно подстрахует)
-		return raw, nil, nil, nil
-	}
-
-	return strings.TrimSpace(tmp.Summary), tmp.Keywords, tmp.NegativeKeywords, nil
-}
-
 func fallbackSummary(u *url.URL, html string) string {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
 	if err == nil {
@@ -471,18 +430,18 @@ func fallbackSummary(u *url.URL, html string) string {
 
 func main() {
 	if os.Getenv("OPENAI_API_KEY") == "" {
-		log.Println("WARN: OPENAI_API_KEY is empty — AI will fallback to heuristic")
+		log.Println("WARN: OPENAI_API_KEY is empty — openai backend will fallback to heuristic")
 	} else {
 		log.Printf("INFO: OPENAI_API_KEY detected (len=%d)\n", len(os.Getenv("OPENAI_API_KEY")))
 	}
-	log.Printf("BOOT: USE_AI=%v MODEL=%s KEY_SET=%t KEY=%s",
-		useAI, modelName, os.Getenv("OPENAI_API_KEY") != "", maskKey(os.Getenv("OPENAI_API_KEY")))
+	log.Printf("BOOT: aiEnabled=%v backends=%s", aiEnabled(), summarizerChain.names())
 	mux := http.NewServeMux()
 	mux.HandleFunc("/classify", classifyHandler)
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
+	mux.HandleFunc("/classify/batch", batchHandler)
+	mux.HandleFunc("GET /cache/{hash}", cacheGetHandler)
+	mux.HandleFunc("DELETE /cache/{hash}", cacheDeleteHandler)
+	mux.HandleFunc("POST /cache/purge", cachePurgeHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
 
 	srv := &http.Server{
 		Addr:              ":8080",
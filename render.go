@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==== headless-рендеринг JS-сайтов (см. render_chromedp.go / render_default.go) ====
+
+// renderMode — значение query-параметра render=... на /classify.
+type renderMode string
+
+const (
+	renderAuto  renderMode = "auto"  // рендерить только если текста мало и включён RENDER_JS
+	renderJS    renderMode = "js"    // рендерить всегда, независимо от порога
+	renderNever renderMode = "never" // никогда не рендерить, даже если включён RENDER_JS
+)
+
+func parseRenderMode(raw string) renderMode {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "js":
+		return renderJS
+	case "never":
+		return renderNever
+	default:
+		return renderAuto
+	}
+}
+
+func renderJSEnabled() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("RENDER_JS")), "true")
+}
+
+func renderThreshold() int {
+	if v := strings.TrimSpace(os.Getenv("RENDER_JS_THRESHOLD")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 200
+}
+
+// maybeRenderJS решает, нужно ли повторно скачать страницу через headless
+// Chromium (fetchRenderedHTML, см. build-теговые файлы), и при необходимости
+// возвращает уже отрендеренный HTML вместо исходного.
+func maybeRenderJS(ctx context.Context, u *url.URL, html string, mode renderMode) string {
+	switch mode {
+	case renderNever:
+		return html
+	case renderJS:
+		// форсируем рендер независимо от порога и RENDER_JS
+	default: // renderAuto
+		if !renderJSEnabled() {
+			return html
+		}
+		if len(strings.TrimSpace(extractVisibleText(html))) >= renderThreshold() {
+			return html
+		}
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+
+	rendered, err := fetchRenderedHTML(rctx, u.String())
+	if err != nil {
+		log.Printf("WARN: headless render failed for %s: %v", u.String(), err)
+		return html
+	}
+	return rendered
+}
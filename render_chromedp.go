@@ -0,0 +1,53 @@
+//go:build chromedp
+
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ==== реальный headless-рендеринг через chromedp (сборка с тегом chromedp) ====
+
+// fetchRenderedHTML открывает target в headless Chromium, дожидается
+// готовности body и краткой паузы на гидратацию SPA, и возвращает
+// итоговый HTML документа после выполнения JS.
+func fetchRenderedHTML(ctx context.Context, target string) (string, error) {
+	allocCtx, allocCancel := newChromeAllocator(ctx)
+	defer allocCancel()
+
+	tabCtx, tabCancel := chromedp.NewContext(allocCtx)
+	defer tabCancel()
+
+	var outerHTML string
+	err := chromedp.Run(tabCtx,
+		chromedp.Navigate(target),
+		chromedp.WaitReady("body"),
+		chromedp.Sleep(500*time.Millisecond),
+		chromedp.OuterHTML("html", &outerHTML, chromedp.ByQuery),
+	)
+	if err != nil {
+		return "", err
+	}
+	return outerHTML, nil
+}
+
+// newChromeAllocator выбирает способ подключения к Chrome: удалённый
+// экземпляр через CHROME_WS (ws:// debugger URL), либо локальный бинарник,
+// путь к которому можно переопределить через CHROME_PATH.
+func newChromeAllocator(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ws := strings.TrimSpace(os.Getenv("CHROME_WS")); ws != "" {
+		return chromedp.NewRemoteAllocator(ctx, ws)
+	}
+
+	opts := append([]chromedp.ExecAllocatorOption{}, chromedp.DefaultExecAllocatorOptions[:]...)
+	opts = append(opts, chromedp.Flag("headless", true))
+	if path := strings.TrimSpace(os.Getenv("CHROME_PATH")); path != "" {
+		opts = append(opts, chromedp.ExecPath(path))
+	}
+	return chromedp.NewExecAllocator(ctx, opts...)
+}
@@ -0,0 +1,19 @@
+//go:build !chromedp
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ==== заглушка headless-рендеринга для сборки без тега chromedp ====
+
+// errRenderJSNotBuilt возвращается, когда бинарь собран без тега chromedp,
+// но кто-то запросил render=js — чтобы не тянуть тяжёлую зависимость в
+// обычную сборку по умолчанию.
+var errRenderJSNotBuilt = errors.New("headless rendering not available: build with -tags chromedp")
+
+func fetchRenderedHTML(ctx context.Context, target string) (string, error) {
+	return "", errRenderJSNotBuilt
+}
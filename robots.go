@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==== robots.txt и вежливый rate-limit по хосту ====
+
+// robotsUserAgent — токен, по которому ищем «свою» группу в robots.txt;
+// должен соответствовать продукту в заголовке User-Agent (см. fetchHTMLConditional).
+const robotsUserAgent = "site-check"
+
+var errRobotsDisallowed = errors.New("robots_disallowed")
+
+// robotsRules — запрещающие правила (Disallow) для одного хоста (уже выбранные под
+// наш User-Agent, либо группа "*", если специфичной нет).
+type robotsRules struct {
+	disallow []string
+}
+
+// allows возвращает false, если path подпадает под самое длинное совпавшее
+// правило Disallow. nil-получатель (robots.txt недоступен) разрешает всё.
+func (r *robotsRules) allows(path string) bool {
+	if r == nil {
+		return true
+	}
+	matched := ""
+	for _, d := range r.disallow {
+		if d == "" {
+			continue
+		}
+		if strings.HasPrefix(path, d) && len(d) > len(matched) {
+			matched = d
+		}
+	}
+	return matched == ""
+}
+
+type robotsCacheEntry struct {
+	rules     *robotsRules
+	fetchedAt time.Time
+}
+
+var robotsCache = struct {
+	mu sync.Mutex
+	m  map[string]robotsCacheEntry
+}{m: make(map[string]robotsCacheEntry)}
+
+func robotsCacheTTL() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("ROBOTS_CACHE_TTL_HOURS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Hour
+		}
+	}
+	return 1 * time.Hour
+}
+
+// isAllowedByRobots решает, можно ли забирать u.Path под нашим User-Agent,
+// подгружая и кэшируя per-host robots.txt (недоступный/битый robots.txt
+// трактуется как «всё разрешено», чтобы не блокировать обычные сайты).
+func isAllowedByRobots(ctx context.Context, u *url.URL) bool {
+	host := strings.ToLower(u.Host)
+
+	robotsCache.mu.Lock()
+	entry, ok := robotsCache.m[host]
+	robotsCache.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < robotsCacheTTL() {
+		return entry.rules.allows(robotsPath(u))
+	}
+
+	rules, err := fetchRobotsRules(ctx, u)
+	if err != nil {
+		log.Printf("WARN: robots.txt fetch failed for %s: %v — allowing by default", host, err)
+		rules = nil
+	}
+
+	robotsCache.mu.Lock()
+	robotsCache.m[host] = robotsCacheEntry{rules: rules, fetchedAt: time.Now()}
+	robotsCache.mu.Unlock()
+
+	return rules.allows(robotsPath(u))
+}
+
+func robotsPath(u *url.URL) string {
+	if p := u.EscapedPath(); p != "" {
+		return p
+	}
+	return "/"
+}
+
+func fetchRobotsRules(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	robotsURL := u.Scheme + "://" + u.Host + "/robots.txt"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "site-check/1.0 (+learning-go)")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil // нет robots.txt — разрешаем всё
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, errors.New("robots.txt non-2xx: " + res.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, 512<<10)) // 512 KiB лимит
+	if err != nil {
+		return nil, err
+	}
+	return parseRobotsTxt(string(b)), nil
+}
+
+// parseRobotsTxt — упрощённый парсер: группы "User-agent: ..." + "Disallow: ...",
+// выбираем группу под robotsUserAgent, иначе "*". Allow/Crawl-delay/Sitemap и
+// прочие директивы игнорируем — для наших целей важен только Disallow.
+func parseRobotsTxt(body string) *robotsRules {
+	type group struct {
+		agents   []string
+		disallow []string
+	}
+
+	var groups []*group
+	var cur *group
+	groupOpen := false // true сразу после User-agent, пока не встретили другую директиву
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		val := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent":
+			if cur == nil || !groupOpen {
+				cur = &group{}
+				groups = append(groups, cur)
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+			groupOpen = true
+		case "disallow":
+			if cur != nil {
+				cur.disallow = append(cur.disallow, val)
+			}
+			groupOpen = false
+		default:
+			groupOpen = false
+		}
+	}
+
+	var specific, wildcard *group
+	for _, g := range groups {
+		for _, a := range g.agents {
+			switch {
+			case a == "*":
+				wildcard = g
+			case strings.Contains(a, robotsUserAgent):
+				specific = g
+			}
+		}
+	}
+
+	chosen := wildcard
+	if specific != nil {
+		chosen = specific
+	}
+	if chosen == nil {
+		return &robotsRules{}
+	}
+	return &robotsRules{disallow: chosen.disallow}
+}
+
+// ==== per-host token-bucket rate limiter ====
+
+// hostBucket — простой token bucket без внешних зависимостей: копим токены
+// со скоростью rate/сек до capacity, каждый запрос тратит один токен.
+type hostBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	rate     float64
+	last     time.Time
+}
+
+func (b *hostBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		if b.tokens < b.capacity {
+			b.tokens += now.Sub(b.last).Seconds() * b.rate
+			if b.tokens > b.capacity {
+				b.tokens = b.capacity
+			}
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		deficit := 1 - b.tokens
+		b.mu.Unlock()
+
+		timer := time.NewTimer(time.Duration(deficit / b.rate * float64(time.Second)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+var rateLimiters = struct {
+	mu sync.Mutex
+	m  map[string]*hostBucket
+}{m: make(map[string]*hostBucket)}
+
+func rateLimiterFor(host string) *hostBucket {
+	rateLimiters.mu.Lock()
+	defer rateLimiters.mu.Unlock()
+	if b, ok := rateLimiters.m[host]; ok {
+		return b
+	}
+	b := &hostBucket{
+		tokens:   float64(rateLimitBurst()),
+		capacity: float64(rateLimitBurst()),
+		rate:     rateLimitQPS(),
+		last:     time.Now(),
+	}
+	rateLimiters.m[host] = b
+	return b
+}
+
+// waitRateLimit блокирует вызывающего до появления свободного токена для
+// host'а, либо до отмены ctx — защищает целевые сайты от перегрузки при
+// пакетной классификации на большом числе воркеров.
+func waitRateLimit(ctx context.Context, host string) error {
+	return rateLimiterFor(strings.ToLower(host)).wait(ctx)
+}
+
+func rateLimitQPS() float64 {
+	if v := strings.TrimSpace(os.Getenv("RATE_LIMIT_QPS")); v != "" {
+		if n, err := strconv.ParseFloat(v, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1.0
+}
+
+func rateLimitBurst() int {
+	if v := strings.TrimSpace(os.Getenv("RATE_LIMIT_BURST")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 2
+}
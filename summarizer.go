@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/openai/openai-go/v2"
+	openaioption "github.com/openai/openai-go/v2/option"
+)
+
+// ==== пайплайн ИИ-классификации: провайдеры + цепочка с отказоустойчивостью ====
+
+// Summary — результат работы одного провайдера.
+type Summary struct {
+	Text             string
+	Keywords         []string
+	NegativeKeywords []string
+}
+
+// Summarizer — единый интерфейс для любого LLM-бэкенда классификации.
+type Summarizer interface {
+	Name() string
+	Summarize(ctx context.Context, text string) (Summary, error)
+}
+
+// classifyPrompt — промпт, общий для всех чат-based провайдеров.
+func classifyPrompt(text string) string {
+	if len(text) > 4000 {
+		text = text[:4000]
+	}
+	return `Ты — сервис классификации сайтов.
+
+1) Кратко, одной деловой фразой по-русски опиши тематику сайта (сфера/услуга/товар и, если явно есть, город/бренд).
+   Не добавляй лишних слов, без пояснений, без ссылок.
+
+2) Сгенерируй список ключевых слов и фраз для запуска рекламы в Яндекс.Директ (30–40 штук, только по этому контенту).
+
+3) Сформируй список минус-слов (30–50), чтобы отсеять нерелевантные запросы.
+
+Верни СТРОГО валидный JSON ровно такой структуры (без пояснений снаружи):
+{
+  "summary": "краткое описание одной фразой",
+  "keywords": ["...", "..."],
+  "negative_keywords": ["...", "..."]
+}
+
+Контент сайта:
+` + text
+}
+
+// parseSummaryJSON разбирает ответ модели. Если модель не вернула валидный
+// JSON, отдаём хотя бы сырой текст как summary — эвристика подстрахует.
+func parseSummaryJSON(raw string) Summary {
+	raw = strings.TrimSpace(raw)
+	var tmp struct {
+		Summary          string   `json:"summary"`
+		Keywords         []string `json:"keywords"`
+		NegativeKeywords []string `json:"negative_keywords"`
+	}
+	if err := json.Unmarshal([]byte(raw), &tmp); err != nil {
+		return Summary{Text: raw}
+	}
+	return Summary{
+		Text:             strings.TrimSpace(tmp.Summary),
+		Keywords:         tmp.Keywords,
+		NegativeKeywords: tmp.NegativeKeywords,
+	}
+}
+
+// isTransientAIError отличает транзиентные ошибки (429/5xx, таймаут, квота)
+// от постоянных. SummarizerChain.Summarize переходит к следующему провайдеру
+// после ошибки любого из этих видов.
+func isTransientAIError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "429") || strings.Contains(msg, "rate limit") ||
+		strings.Contains(msg, "quota") || strings.Contains(msg, "timeout") ||
+		strings.Contains(msg, "deadline exceeded")
+}
+
+// isQuotaAIError отличает специфичный случай исчерпания квоты — тогда в
+// classifyResponse.Source мы ставим не голый "heuristic", а "ai_quota",
+// чтобы было видно, почему ИИ не сработал.
+func isQuotaAIError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "quota") || strings.Contains(msg, "429")
+}
+
+// ==== провайдер: OpenAI ====
+
+type openAISummarizer struct {
+	client openai.Client
+	model  string
+	name   string
+}
+
+func newOpenAISummarizer(client openai.Client, model string) *openAISummarizer {
+	return &openAISummarizer{client: client, model: model, name: "openai"}
+}
+
+func (s *openAISummarizer) Name() string { return s.name }
+
+func (s *openAISummarizer) Summarize(ctx context.Context, text string) (Summary, error) {
+	resp, err := s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: s.model,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage(classifyPrompt(text)),
+		},
+		MaxTokens:   openai.Int(800),
+		Temperature: openai.Float(0.2),
+		Seed:        openai.Int(42),
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return Summary{}, errors.New("no choices from AI")
+	}
+	raw := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if raw == "" {
+		return Summary{}, errors.New("empty AI response")
+	}
+	return parseSummaryJSON(raw), nil
+}
+
+// ==== провайдер: Anthropic ====
+
+type anthropicSummarizer struct {
+	client anthropic.Client
+	model  anthropic.Model
+}
+
+func newAnthropicSummarizer() (*anthropicSummarizer, error) {
+	apiKey := strings.TrimSpace(os.Getenv("ANTHROPIC_API_KEY"))
+	if apiKey == "" {
+		apiKey = strings.TrimSpace(os.Getenv("AI_API_KEY"))
+	}
+	if apiKey == "" {
+		return nil, errors.New("ANTHROPIC_API_KEY (or AI_API_KEY) is not set")
+	}
+
+	opts := []anthropicoption.RequestOption{anthropicoption.WithAPIKey(apiKey)}
+	if base := strings.TrimSpace(os.Getenv("AI_BASE_URL")); base != "" {
+		opts = append(opts, anthropicoption.WithBaseURL(base))
+	}
+
+	model := strings.TrimSpace(os.Getenv("ANTHROPIC_MODEL"))
+	if model == "" {
+		model = strings.TrimSpace(os.Getenv("AI_MODEL"))
+	}
+	if model == "" {
+		model = string(anthropic.ModelClaude3_5HaikuLatest)
+	}
+
+	return &anthropicSummarizer{
+		client: anthropic.NewClient(opts...),
+		model:  anthropic.Model(model),
+	}, nil
+}
+
+func (s *anthropicSummarizer) Name() string { return "anthropic" }
+
+func (s *anthropicSummarizer) Summarize(ctx context.Context, text string) (Summary, error) {
+	resp, err := s.client.Messages.New(ctx, anthropic.MessageNewParams{
+		Model:     s.model,
+		MaxTokens: 800,
+		Messages: []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(classifyPrompt(text))),
+		},
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+	if len(resp.Content) == 0 {
+		return Summary{}, errors.New("empty anthropic response")
+	}
+	return parseSummaryJSON(strings.TrimSpace(resp.Content[0].Text)), nil
+}
+
+// ==== провайдер: локальный OpenAI-совместимый эндпоинт (Ollama/vLLM/LM Studio) ====
+
+func newLocalSummarizer() (*openAISummarizer, error) {
+	base := strings.TrimSpace(os.Getenv("AI_BASE_URL"))
+	if base == "" {
+		return nil, errors.New("AI_BASE_URL is not set")
+	}
+	model := strings.TrimSpace(os.Getenv("AI_MODEL"))
+	if model == "" {
+		return nil, errors.New("AI_MODEL is not set")
+	}
+
+	opts := []openaioption.RequestOption{openaioption.WithBaseURL(base)}
+	if apiKey := strings.TrimSpace(os.Getenv("AI_API_KEY")); apiKey != "" {
+		opts = append(opts, openaioption.WithAPIKey(apiKey))
+	} else {
+		// большинству локальных серверов ключ не нужен, но SDK требует
+		// непустое значение для заголовка Authorization
+		opts = append(opts, openaioption.WithAPIKey("local"))
+	}
+
+	s := newOpenAISummarizer(openai.NewClient(opts...), model)
+	s.name = "local"
+	return s, nil
+}
+
+// ==== no-op провайдер для тестов ====
+
+// noopSummarizer не ходит в сеть — используется в тестах и когда
+// AI_PROVIDER=stub, чтобы прогнать пайплайн без реального ключа.
+type noopSummarizer struct{}
+
+func (noopSummarizer) Name() string { return "stub" }
+
+func (noopSummarizer) Summarize(_ context.Context, _ string) (Summary, error) {
+	return Summary{}, errors.New("noop summarizer: not configured")
+}
+
+// ==== цепочка провайдеров с circuit breaker ====
+
+func circuitBreakerThreshold() int {
+	if v := strings.TrimSpace(os.Getenv("AI_CIRCUIT_THRESHOLD")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 3
+}
+
+func circuitBreakerCooldown() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("AI_CIRCUIT_COOLDOWN_SEC")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 30 * time.Second
+}
+
+// chainBackend оборачивает Summarizer счётчиком подряд идущих неудач: после
+// circuitBreakerThreshold() ошибок подряд бэкенд временно пропускается.
+type chainBackend struct {
+	Summarizer
+
+	mu          sync.Mutex
+	failures    int
+	openedUntil time.Time
+}
+
+func (b *chainBackend) circuitOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openedUntil.IsZero() && time.Now().Before(b.openedUntil)
+}
+
+func (b *chainBackend) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openedUntil = time.Time{}
+}
+
+func (b *chainBackend) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= circuitBreakerThreshold() {
+		b.openedUntil = time.Now().Add(circuitBreakerCooldown())
+	}
+}
+
+func (b *chainBackend) failureCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures
+}
+
+// SummarizerChain пробует бэкенды по порядку, переходя к следующему при
+// транзиентных ошибках (429/5xx/таймаут), и запоминает для каждого число
+// подряд идущих неудач, чтобы временно не дёргать заведомо недоступный.
+type SummarizerChain struct {
+	backends []*chainBackend
+}
+
+func (c *SummarizerChain) add(s Summarizer) {
+	c.backends = append(c.backends, &chainBackend{Summarizer: s})
+}
+
+func (c *SummarizerChain) names() string {
+	names := make([]string, 0, len(c.backends))
+	for _, b := range c.backends {
+		names = append(names, b.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+var errAllProvidersFailed = errors.New("all AI providers failed or are unavailable")
+
+// Summarize пробует бэкенды по очереди и возвращает результат первого
+// успешного; источник возвращается как "ai:<name>", либо "ai_quota", если
+// последняя опробованная ошибка была связана с превышением квоты.
+func (c *SummarizerChain) Summarize(ctx context.Context, text string) (Summary, string, error) {
+	var lastErr error
+	for _, b := range c.backends {
+		if b.circuitOpen() {
+			continue
+		}
+		sum, err := b.Summarize(ctx, text)
+		if err == nil {
+			b.recordSuccess()
+			return sum, "ai:" + b.Name(), nil
+		}
+		lastErr = err
+		if isQuotaAIError(err) || isTransientAIError(err) {
+			b.recordFailure()
+			continue
+		}
+		// постоянная ошибка (неверный ключ, невалидный запрос и т.п.) — тоже
+		// даём шанс следующему провайдеру, но не открываем "quota"-ветку
+		b.recordFailure()
+	}
+	if lastErr != nil && isQuotaAIError(lastErr) {
+		return Summary{}, "ai_quota", lastErr
+	}
+	if lastErr == nil {
+		lastErr = errAllProvidersFailed
+	}
+	return Summary{}, "", lastErr
+}
+
+// ==== сборка цепочки из окружения ====
+
+var summarizerChain = buildSummarizerChain()
+
+func buildSummarizerChain() *SummarizerChain {
+	chain := &SummarizerChain{}
+
+	order := strings.Split(strings.ToLower(strings.TrimSpace(os.Getenv("AI_PROVIDER"))), ",")
+	if len(order) == 1 && order[0] == "" {
+		if strings.ToLower(os.Getenv("USE_AI")) == "true" {
+			order = []string{"openai"}
+		} else {
+			order = nil
+		}
+	}
+
+	for _, name := range order {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case "openai":
+			model := strings.TrimSpace(os.Getenv("AI_MODEL"))
+			if model == "" {
+				model = "gpt-3.5-turbo"
+			}
+			chain.add(newOpenAISummarizer(openai.NewClient(), model))
+		case "anthropic":
+			s, err := newAnthropicSummarizer()
+			if err != nil {
+				log.Printf("WARN: anthropic backend not configured: %v", err)
+				continue
+			}
+			chain.add(s)
+		case "local":
+			s, err := newLocalSummarizer()
+			if err != nil {
+				log.Printf("WARN: local backend not configured: %v", err)
+				continue
+			}
+			chain.add(s)
+		case "stub", "noop":
+			chain.add(noopSummarizer{})
+		default:
+			log.Printf("WARN: unknown AI_PROVIDER entry %q ignored", name)
+		}
+	}
+	return chain
+}
+
+func aiEnabled() bool {
+	return len(summarizerChain.backends) > 0
+}
+
+// aiSemaphore ограничивает число одновременных обращений к LLM-провайдерам,
+// чтобы пакетная обработка (см. batch.go) не упиралась в rate limit.
+var aiSemaphore = make(chan struct{}, aiConcurrency())
+
+func aiConcurrency() int {
+	if v := strings.TrimSpace(os.Getenv("AI_CONCURRENCY")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 4
+}
+
+// summarizeViaChain — точка входа для классификатора: один таймаут на всю
+// цепочку, один лимит параллелизма на всех провайдеров сразу.
+func summarizeViaChain(ctx context.Context, text string) (Summary, string, error) {
+	cctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	select {
+	case aiSemaphore <- struct{}{}:
+		defer func() { <-aiSemaphore }()
+	case <-cctx.Done():
+		return Summary{}, "", cctx.Err()
+	}
+
+	return summarizerChain.Summarize(cctx, text)
+}
+
+// ==== /healthz ====
+
+type backendHealth struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Failures  int    `json:"failures"`
+}
+
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	backends := make([]backendHealth, 0, len(summarizerChain.backends))
+	for _, b := range summarizerChain.backends {
+		backends = append(backends, backendHealth{
+			Name:      b.Name(),
+			Available: !b.circuitOpen(),
+			Failures:  b.failureCount(),
+		})
+	}
+	resp := struct {
+		Status   string          `json:"status"`
+		Backends []backendHealth `json:"backends,omitempty"`
+	}{Status: "ok", Backends: backends}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}